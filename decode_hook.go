@@ -2,7 +2,7 @@ package atc
 
 import (
 	"encoding/json"
-	"errors"
+	"fmt"
 	"reflect"
 	"strconv"
 )
@@ -28,7 +28,7 @@ var SanitizeDecodeHook = func(
 				return strconv.FormatFloat(f, 'f', -1, 64), nil
 			}
 
-			return nil, errors.New("impossible: float64 != float64")
+			return nil, fmt.Errorf("impossible: float64 != float64")
 		}
 
 		// format it as JSON/YAML would
@@ -38,39 +38,29 @@ var SanitizeDecodeHook = func(
 	return data, nil
 }
 
+// sanitize walks a YAML/JSON-decoded document, turning every
+// map[interface{}]interface{} into a map[string]interface{} so it can be
+// unmarshalled by mapstructure regardless of which frontend produced it. It
+// stops at the first offending key and reports where it was found; use
+// SanitizeStrict to collect every violation in one pass instead.
 func sanitize(root interface{}) (interface{}, error) {
-	switch rootVal := root.(type) {
-	case map[interface{}]interface{}:
-		sanitized := map[string]interface{}{}
-
-		for key, val := range rootVal {
-			str, ok := key.(string)
-			if !ok {
-				return nil, errors.New("non-string key")
-			}
-
-			sub, err := sanitize(val)
-			if err != nil {
-				return nil, err
-			}
-
-			sanitized[str] = sub
-		}
+	return sanitizeWithSkip(root, nil)
+}
 
-		return sanitized, nil
+// sanitizeWithSkip is sanitize plus skip, the set of map keys that should be
+// left as a *LazyValue rather than recursively sanitized. Decoder.Decode
+// uses this (via lazyFieldKeys) so a struct field declared as *LazyValue
+// never pays for sanitizing its subtree before LazyValueHookFunc gets it --
+// sanitizing the whole document up front and only then handing a
+// *LazyValue field its already-sanitized value would defeat the point of
+// SanitizeLazy entirely.
+func sanitizeWithSkip(root interface{}, skip map[string]bool) (interface{}, error) {
+	var errs SanitizeErrors
 
-	case []interface{}:
-		sanitized := make([]interface{}, len(rootVal))
-		for i, val := range rootVal {
-			sub, err := sanitize(val)
-			if err != nil {
-				return nil, err
-			}
-			sanitized[i] = sub
-		}
-		return sanitized, nil
-
-	default:
-		return rootVal, nil
+	sanitized := sanitizeWalk(root, nil, false, &errs, skip)
+	if len(errs) > 0 {
+		return nil, errs[0]
 	}
+
+	return sanitized, nil
 }
@@ -0,0 +1,200 @@
+package atc
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/BurntSushi/toml"
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v2"
+)
+
+// Decoder decodes pipeline, task, and resource type configs written in any
+// of the formats Concourse accepts, normalizing them through sanitize so
+// that downstream mapstructure decodes see a consistent map[string]interface{}
+// / []interface{} / scalar shape regardless of which frontend produced them.
+type Decoder struct {
+	// Strict, when set, rejects documents that decode successfully but
+	// contain suspicious constructs (duplicate keys, NaN/Inf floats, etc).
+	Strict bool
+}
+
+// NewDecoder returns a Decoder with default (non-strict) options.
+func NewDecoder() *Decoder {
+	return &Decoder{}
+}
+
+// Decode parses data in the given format and unmarshals the sanitized result
+// into into, which is typically a pointer to an atc.Config, atc.TaskConfig,
+// or similar. Passing FormatAuto sniffs the format from the content. Any
+// hooks registered on DefaultHooks run as part of the decode; use
+// DecodeWithRegistry directly to scope hooks to a single call instead.
+//
+// The returned error is nil on a clean decode -- even one where a hook
+// raised a warning, since a warning alone isn't a reason to reject an
+// otherwise-valid pipeline -- a *Diagnostics wrapping any SanitizeErrors
+// (with any warnings attached, so they're still visible to a caller that
+// type-asserts for them) for one that isn't, or some other error for a
+// parse/hook failure that has nothing to do with sanitize. A caller that
+// wants a document's warnings regardless of whether it also had errors
+// should call DecodeWithRegistry directly instead.
+func (d *Decoder) Decode(data []byte, format Format, into interface{}) error {
+	warnings, err := d.DecodeWithRegistry(data, format, into, DefaultHooks)
+	diag := newDiagnostics(err, warnings)
+	if diag, ok := diag.(*Diagnostics); ok && !diag.HasErrors() {
+		return nil
+	}
+
+	return diag
+}
+
+// DecodeWithRegistry behaves like Decode, but additionally runs reg's
+// before-sanitize and after-sanitize hooks over the document, returning any
+// warnings they emitted. A nil reg skips hook processing entirely.
+func (d *Decoder) DecodeWithRegistry(data []byte, format Format, into interface{}, reg *HookRegistry) ([]*SanitizeWarning, error) {
+	resolved := format
+	if resolved == FormatAuto {
+		resolved = sniffFormat(data)
+	}
+
+	raw, err := parseFormat(data, resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []*SanitizeWarning
+
+	if reg != nil {
+		raw, err = reg.apply(HookBeforeSanitize, raw, &warnings)
+		if err != nil {
+			return warnings, fmt.Errorf("before-sanitize hook failed: %w", err)
+		}
+	}
+
+	// Map keys named like a *LazyValue field anywhere in into's type graph
+	// (a job's params block, say) are wrapped into a *LazyValue by the
+	// sanitize pass itself, which decodeInto's LazyValueHookFunc passes
+	// through, so their subtrees are never rebuilt unless a caller actually
+	// reads them. Strict mode still walks them once for its checks.
+	skip := lazyFieldKeys(reflect.TypeOf(into))
+
+	var sanitized interface{}
+	if d.Strict {
+		sanitized, err = d.sanitizeStrict(data, resolved, raw, skip)
+	} else {
+		sanitized, err = sanitizeWithSkip(raw, skip)
+	}
+	if err != nil {
+		if resolved == FormatYAML {
+			err = AnnotateLines(data, err)
+		}
+		return warnings, fmt.Errorf("failed to sanitize %s: %w", resolved, err)
+	}
+
+	if reg != nil {
+		sanitized, err = reg.apply(HookAfterSanitize, sanitized, &warnings)
+		if err != nil {
+			return warnings, fmt.Errorf("after-sanitize hook failed: %w", err)
+		}
+	}
+
+	return warnings, decodeInto(sanitized, into)
+}
+
+// sanitizeStrict runs SanitizeStrict plus duplicate-key detection, which
+// has to scan data's original bytes rather than raw: by the time raw
+// exists, yaml.Unmarshal/json.Unmarshal has already collapsed any duplicate
+// keys into whichever one it saw last. TOML's BurntSushi decoder rejects
+// duplicate keys itself during parseFormat, and HCL blocks can't have
+// colliding attribute names, so only YAML and JSON need the extra pass.
+func (d *Decoder) sanitizeStrict(data []byte, format Format, raw interface{}, skip map[string]bool) (interface{}, error) {
+	sanitized, err := sanitizeStrictWithSkip(raw, skip)
+
+	var errs SanitizeErrors
+	if se, ok := err.(SanitizeErrors); ok {
+		errs = se
+	} else if err != nil {
+		return nil, err
+	}
+
+	var dupErrs SanitizeErrors
+	var dupErr error
+	switch format {
+	case FormatYAML:
+		dupErrs, dupErr = detectDuplicateKeysYAML(data)
+	case FormatJSON:
+		dupErrs, dupErr = detectDuplicateKeysJSON(data)
+	}
+	if dupErr != nil {
+		return nil, dupErr
+	}
+
+	errs = append(errs, dupErrs...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return sanitized, nil
+}
+
+// decodeInto hands the sanitized document to mapstructure, composing two
+// hooks: SanitizeDecodeHook, so a string-typed field receiving a numeric
+// YAML/JSON scalar (a docker tag like `tag: 1.20`, say) still gets coerced
+// to a string the way it always has; and LazyValueHookFunc, so a struct
+// field declared as *LazyValue (a job's opaque params/config blob) is
+// wrapped rather than eagerly materialized.
+func decodeInto(sanitized interface{}, into interface{}) error {
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			SanitizeDecodeHook,
+			LazyValueHookFunc(),
+		),
+		Result: into,
+	})
+	if err != nil {
+		return err
+	}
+
+	return dec.Decode(sanitized)
+}
+
+// parseFormat parses data according to the already-resolved format,
+// returning the raw YAML/JSON-shaped document before sanitize runs.
+func parseFormat(data []byte, format Format) (interface{}, error) {
+	var raw interface{}
+	var err error
+
+	switch format {
+	case FormatYAML:
+		err = yaml.Unmarshal(data, &raw)
+	case FormatJSON:
+		err = json.Unmarshal(data, &raw)
+	case FormatTOML:
+		err = toml.Unmarshal(data, &raw)
+	case FormatHCL:
+		raw, err = decodeHCL(data)
+	default:
+		return nil, fmt.Errorf("unsupported config format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", format, err)
+	}
+
+	return raw, nil
+}
+
+// DecodeWithHooks decodes data (always auto-detecting its format) into into,
+// running hooks before and after the usual sanitize normalization. Only the
+// given hooks run; DefaultHooks is not consulted. It's the entry point
+// pipeline, task, and resource type config parsing should use so that
+// registered hooks -- var interpolation, redaction, env expansion -- apply
+// uniformly regardless of call site.
+func DecodeWithHooks(data []byte, into interface{}, hooks ...DecodeHook) ([]*SanitizeWarning, error) {
+	reg := NewHookRegistry()
+	for _, h := range hooks {
+		reg.Register(h)
+	}
+
+	return NewDecoder().DecodeWithRegistry(data, FormatAuto, into, reg)
+}
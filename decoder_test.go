@@ -0,0 +1,84 @@
+package atc
+
+import "testing"
+
+func TestDecodeCoercesFloatToString(t *testing.T) {
+	var into struct {
+		Tag string `mapstructure:"tag"`
+	}
+
+	if err := NewDecoder().Decode([]byte(`tag: 1.20`), FormatYAML, &into); err != nil {
+		t.Fatal(err)
+	}
+
+	if into.Tag != "1.2" {
+		t.Errorf("expected tag %q, got %q", "1.2", into.Tag)
+	}
+}
+
+func TestDecodeSurfacesHookWarnings(t *testing.T) {
+	reg := NewHookRegistry()
+	reg.Register(DecodeHook{
+		Name:  "flag-everything",
+		Phase: HookAfterSanitize,
+		Run: func(path Path, value interface{}) (interface{}, []*SanitizeWarning, error) {
+			if len(path) == 0 {
+				return value, []*SanitizeWarning{{Hook: "flag-everything", Message: "just saying hi"}}, nil
+			}
+			return value, nil, nil
+		},
+	})
+
+	var into struct {
+		Tag string `mapstructure:"tag"`
+	}
+
+	warnings, err := NewDecoder().DecodeWithRegistry([]byte(`tag: "1.2"`), FormatYAML, &into, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning from DecodeWithRegistry, got %d", len(warnings))
+	}
+
+	diagErr := newDiagnostics(nil, warnings)
+	diag, ok := diagErr.(*Diagnostics)
+	if !ok {
+		t.Fatalf("expected *Diagnostics, got %T", diagErr)
+	}
+	if diag.HasErrors() {
+		t.Errorf("expected no errors, got %v", diag.Errors)
+	}
+	if len(diag.Warnings) != 1 {
+		t.Fatalf("expected 1 warning surfaced via Diagnostics, got %d", len(diag.Warnings))
+	}
+}
+
+func TestDecodeDoesNotErrorOnWarningsAlone(t *testing.T) {
+	reg := NewHookRegistry()
+	reg.Register(DecodeHook{
+		Name:  "flag-everything",
+		Phase: HookAfterSanitize,
+		Run: func(path Path, value interface{}) (interface{}, []*SanitizeWarning, error) {
+			if len(path) == 0 {
+				return value, []*SanitizeWarning{{Hook: "flag-everything", Message: "just saying hi"}}, nil
+			}
+			return value, nil, nil
+		},
+	})
+
+	savedDefault := DefaultHooks
+	DefaultHooks = reg
+	defer func() { DefaultHooks = savedDefault }()
+
+	var into struct {
+		Tag string `mapstructure:"tag"`
+	}
+
+	// A hook-emitted warning alone is not a reason for a standard
+	// if err := dec.Decode(...); err != nil { reject } caller to reject an
+	// otherwise-valid pipeline.
+	if err := NewDecoder().Decode([]byte(`tag: "1.2"`), FormatYAML, &into); err != nil {
+		t.Fatalf("expected no error for a warnings-only decode, got %v", err)
+	}
+}
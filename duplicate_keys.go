@@ -0,0 +1,113 @@
+package atc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// jsonContainer tracks one open object or array while detectDuplicateKeysJSON
+// streams tokens, so it can tell a key from a value and build up each node's
+// Path as it goes.
+type jsonContainer struct {
+	path Path
+	// isArray distinguishes a '[' container from a '{' one; seen/pendingKey
+	// /awaitingKey are only meaningful for objects.
+	isArray     bool
+	idx         int
+	seen        map[string]bool
+	pendingKey  string
+	awaitingKey bool
+}
+
+// detectDuplicateKeysJSON scans data's raw token stream for object keys that
+// appear more than once. It has to run against the original bytes: by the
+// time sanitize sees a document, json.Unmarshal has already collapsed
+// duplicate keys into whichever one it saw last.
+func detectDuplicateKeysJSON(data []byte) (SanitizeErrors, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	var stack []*jsonContainer
+	var errs SanitizeErrors
+
+	childPath := func() Path {
+		if len(stack) == 0 {
+			return nil
+		}
+
+		top := stack[len(stack)-1]
+		if top.isArray {
+			return top.path.push(top.idx)
+		}
+
+		return top.path.push(top.pendingKey)
+	}
+
+	valueConsumed := func() {
+		if len(stack) == 0 {
+			return
+		}
+
+		top := stack[len(stack)-1]
+		if top.isArray {
+			top.idx++
+		} else {
+			top.awaitingKey = true
+		}
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		delim, isDelim := tok.(json.Delim)
+		if isDelim {
+			switch delim {
+			case '{':
+				stack = append(stack, &jsonContainer{
+					path:        childPath(),
+					seen:        map[string]bool{},
+					awaitingKey: true,
+				})
+				continue
+
+			case '[':
+				stack = append(stack, &jsonContainer{path: childPath(), isArray: true})
+				continue
+
+			case '}', ']':
+				stack = stack[:len(stack)-1]
+				valueConsumed()
+				continue
+			}
+		}
+
+		top := len(stack) > 0
+		if top && !stack[len(stack)-1].isArray && stack[len(stack)-1].awaitingKey {
+			container := stack[len(stack)-1]
+			key := tok.(string)
+
+			if container.seen[key] {
+				errs = append(errs, &SanitizeError{
+					Path:  container.path.push(key),
+					Value: key,
+					Code:  SanitizeErrorDuplicateKey,
+				})
+			}
+			container.seen[key] = true
+			container.pendingKey = key
+			container.awaitingKey = false
+			continue
+		}
+
+		// A scalar value (string, number, bool, or null).
+		valueConsumed()
+	}
+
+	return errs, nil
+}
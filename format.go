@@ -0,0 +1,104 @@
+package atc
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Format identifies the serialization used to encode a pipeline, task, or
+// resource type config.
+type Format int
+
+const (
+	// FormatAuto detects the format from the content itself, falling back
+	// to YAML when detection is inconclusive.
+	FormatAuto Format = iota
+	FormatYAML
+	FormatJSON
+	FormatTOML
+	FormatHCL
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatAuto:
+		return "auto"
+	case FormatYAML:
+		return "yaml"
+	case FormatJSON:
+		return "json"
+	case FormatTOML:
+		return "toml"
+	case FormatHCL:
+		return "hcl"
+	default:
+		return fmt.Sprintf("unknown-format-%d", int(f))
+	}
+}
+
+// ParseFormat maps a CLI flag value or HTTP content-type suffix (e.g.
+// "application/x-yaml") onto a Format.
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "", "auto":
+		return FormatAuto, nil
+	case "yaml", "yml", "application/x-yaml":
+		return FormatYAML, nil
+	case "json", "application/json":
+		return FormatJSON, nil
+	case "toml", "application/toml":
+		return FormatTOML, nil
+	case "hcl", "application/hcl":
+		return FormatHCL, nil
+	default:
+		return FormatAuto, fmt.Errorf("unknown config format: %s", s)
+	}
+}
+
+// sniffFormat guesses the format of data when the caller passed FormatAuto.
+// It only needs to distinguish between the formats we support; anything it
+// can't confidently identify falls back to YAML, since YAML is a superset of
+// JSON and was Concourse's original config format.
+func sniffFormat(data []byte) Format {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return FormatYAML
+	}
+
+	switch trimmed[0] {
+	case '{', '[':
+		return FormatJSON
+	}
+
+	if looksLikeHCL(trimmed) {
+		return FormatHCL
+	}
+
+	if looksLikeTOML(trimmed) {
+		return FormatTOML
+	}
+
+	return FormatYAML
+}
+
+// looksLikeHCL checks for the block syntax ("resource \"foo\" {") that
+// doesn't appear in valid YAML or TOML documents.
+func looksLikeHCL(data []byte) bool {
+	return bytes.Contains(data, []byte("\" {")) || bytes.Contains(data, []byte(") {"))
+}
+
+// looksLikeTOML checks for a "[section]" table header on its own line, which
+// YAML would parse as a flow sequence and so never appears at the start of a
+// YAML document line.
+func looksLikeTOML(data []byte) bool {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] != '[' {
+			continue
+		}
+
+		return bytes.HasSuffix(line, []byte("]")) && !bytes.Contains(line, []byte(":"))
+	}
+
+	return false
+}
@@ -0,0 +1,145 @@
+package atc
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// decodeHCL parses an HCL document into the same generic
+// map[string]interface{} / []interface{} / scalar shape that the YAML and
+// JSON frontends produce, so it can be sanitized uniformly. gohcl/hclsimple
+// only decode into tagged structs, and the pipeline configs this decodes
+// use block syntax ("job \"build\" { ... }") that has no fixed schema, so we
+// walk the native syntax tree (attributes and nested blocks) ourselves
+// instead.
+func decodeHCL(data []byte) (interface{}, error) {
+	file, diags := hclparse.NewParser().ParseHCL(data, "pipeline.hcl")
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, fmt.Errorf("unexpected HCL body type %T", file.Body)
+	}
+
+	return hclBodyToMap(body)
+}
+
+// hclBlockTypeKeys maps an HCL block type to the mapstructure key a decoded
+// pipeline config expects it under. HCL block syntax names a block after a
+// single instance of it (job "build" { ... }), while Config and its kin
+// name the field after the collection (Jobs []JobConfig
+// `mapstructure:"jobs"`); this bridges the two so block-syntax pipelines
+// decode into the same structs attribute-syntax ones
+// (jobs = [{...}, {...}]) already do. A block type with no entry here is
+// used as-is.
+var hclBlockTypeKeys = map[string]string{
+	"job": "jobs",
+}
+
+// hclBodyToMap converts one HCL body -- the attributes and nested blocks
+// inside a file or a single block -- into a map[string]interface{}.
+func hclBodyToMap(body *hclsyntax.Body) (map[string]interface{}, error) {
+	out := map[string]interface{}{}
+
+	for name, attr := range body.Attributes {
+		val, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		v, err := ctyToInterface(val)
+		if err != nil {
+			return nil, err
+		}
+
+		out[name] = v
+	}
+
+	for _, block := range body.Blocks {
+		sub, err := hclBodyToMap(block.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(block.Labels) > 0 {
+			// A block's labels (the "build" in job "build" { ... }) carry
+			// information that would otherwise be lost once it's flattened
+			// into a plain map.
+			labels := make([]interface{}, len(block.Labels))
+			for i, l := range block.Labels {
+				labels[i] = l
+			}
+			sub["labels"] = labels
+		}
+
+		key := block.Type
+		if alias, ok := hclBlockTypeKeys[key]; ok {
+			key = alias
+		}
+
+		// Always a list, even for the first (or only) block of this type,
+		// so a block-syntax pipeline decodes the same way regardless of how
+		// many of a given block it has -- a schema field like Config.Jobs
+		// is always a slice, never "a slice unless there's exactly one".
+		list, _ := out[key].([]interface{})
+		out[key] = append(list, sub)
+	}
+
+	return out, nil
+}
+
+// ctyToInterface converts an evaluated HCL expression value into the same
+// generic shape sanitize expects: map[string]interface{}, []interface{}, or
+// a scalar.
+func ctyToInterface(val cty.Value) (interface{}, error) {
+	if val.IsNull() {
+		return nil, nil
+	}
+
+	t := val.Type()
+	switch {
+	case t == cty.String:
+		return val.AsString(), nil
+
+	case t == cty.Bool:
+		return val.True(), nil
+
+	case t == cty.Number:
+		f, _ := val.AsBigFloat().Float64()
+		return f, nil
+
+	case t.IsTupleType(), t.IsListType(), t.IsSetType():
+		out := []interface{}{}
+		it := val.ElementIterator()
+		for it.Next() {
+			_, ev := it.Element()
+			v, err := ctyToInterface(ev)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+
+	case t.IsObjectType(), t.IsMapType():
+		out := map[string]interface{}{}
+		it := val.ElementIterator()
+		for it.Next() {
+			k, ev := it.Element()
+			v, err := ctyToInterface(ev)
+			if err != nil {
+				return nil, err
+			}
+			out[k.AsString()] = v
+		}
+		return out, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported HCL value type %s", t.FriendlyName())
+	}
+}
@@ -0,0 +1,100 @@
+package atc
+
+import "testing"
+
+func TestDecodeHCLBlocks(t *testing.T) {
+	src := `
+job "build" {
+  serial = true
+
+  plan {
+    task = "unit"
+  }
+}
+
+job "deploy" {
+  plan {
+    task = "push"
+  }
+}
+`
+
+	raw, err := decodeHCL([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, ok := raw.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected a map, got %T", raw)
+	}
+
+	jobs, ok := root["jobs"].([]interface{})
+	if !ok {
+		t.Fatalf("expected root[\"jobs\"] to be a list (two job blocks, aliased from the \"job\" block type), got %T", root["jobs"])
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("expected 2 job blocks, got %d", len(jobs))
+	}
+
+	build, ok := jobs[0].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected job block to be a map, got %T", jobs[0])
+	}
+
+	labels, ok := build["labels"].([]interface{})
+	if !ok || len(labels) != 1 || labels[0] != "build" {
+		t.Fatalf("expected labels [\"build\"], got %#v", build["labels"])
+	}
+
+	if serial, _ := build["serial"].(bool); !serial {
+		t.Errorf("expected serial = true, got %#v", build["serial"])
+	}
+
+	plans, ok := build["plan"].([]interface{})
+	if !ok {
+		t.Fatalf("expected plan to be a list (a single block is still a one-element list), got %T", build["plan"])
+	}
+	if len(plans) != 1 {
+		t.Fatalf("expected 1 plan block, got %d", len(plans))
+	}
+
+	plan, ok := plans[0].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected plan block to be a map, got %T", plans[0])
+	}
+	if plan["task"] != "unit" {
+		t.Errorf("expected plan.task %q, got %#v", "unit", plan["task"])
+	}
+}
+
+func TestDecodeHCLViaDecoder(t *testing.T) {
+	src := `
+job "build" {
+  name = "build"
+
+  plan {
+    task = "unit"
+  }
+}
+`
+
+	var cfg Config
+	err := NewDecoder().Decode([]byte(src), FormatHCL, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.Jobs) != 1 {
+		t.Fatalf("expected 1 job, got %d", len(cfg.Jobs))
+	}
+	if cfg.Jobs[0].Name != "build" {
+		t.Errorf("expected job name %q, got %q", "build", cfg.Jobs[0].Name)
+	}
+	if len(cfg.Jobs[0].Plan) != 1 {
+		t.Fatalf("expected 1 plan step, got %d", len(cfg.Jobs[0].Plan))
+	}
+	if cfg.Jobs[0].Plan[0].Task != "unit" {
+		t.Errorf("expected task %q, got %q", "unit", cfg.Jobs[0].Plan[0].Task)
+	}
+}
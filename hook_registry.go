@@ -0,0 +1,211 @@
+package atc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// HookPhase identifies when a DecodeHook runs relative to sanitize.
+type HookPhase int
+
+const (
+	// HookBeforeSanitize runs against the raw, frontend-shaped document
+	// (map[interface{}]interface{} for YAML), before keys are collapsed to
+	// strings. Useful for transformations that care about the original
+	// key types.
+	HookBeforeSanitize HookPhase = iota
+
+	// HookAfterSanitize runs against the sanitized map[string]interface{}
+	// / []interface{} document, before it's handed to mapstructure. This is
+	// where most subsystems should register: var interpolation, redaction,
+	// env expansion all only need to reason about string keys.
+	HookAfterSanitize
+)
+
+// SanitizeWarning is a non-fatal diagnostic raised by a DecodeHook -- e.g.
+// "no var source resolved ((foo.bar))" -- that should reach the user
+// alongside any SanitizeErrors, without aborting the decode.
+type SanitizeWarning struct {
+	Path    Path
+	Hook    string
+	Message string
+}
+
+func (w *SanitizeWarning) String() string {
+	return fmt.Sprintf("%s: %s (at %s)", w.Hook, w.Message, w.Path)
+}
+
+// Diagnostics aggregates the SanitizeErrors and hook-emitted SanitizeWarnings
+// produced by a single decode, so warnings reach a caller through the same
+// error value as the errors they accompany. Decode returns one only when the
+// decode had sanitize errors; a decode that raised warnings alone returns
+// nil from Decode, and its warnings come back from DecodeWithRegistry
+// instead. It implements error so a caller that only
+// cares about success/failure keeps working unchanged; one that wants the
+// diagnostics in full can type-assert for *Diagnostics.
+type Diagnostics struct {
+	Errors   SanitizeErrors
+	Warnings []*SanitizeWarning
+}
+
+func (d *Diagnostics) Error() string {
+	if len(d.Errors) == 0 {
+		return fmt.Sprintf("%d warning(s)", len(d.Warnings))
+	}
+
+	return d.Errors.Error()
+}
+
+// HasErrors reports whether any violation -- as opposed to a mere warning --
+// was found.
+func (d *Diagnostics) HasErrors() bool {
+	return len(d.Errors) > 0
+}
+
+// newDiagnostics builds a *Diagnostics from a decode's error and warnings,
+// or returns nil if there's nothing to report. A *SanitizeError or
+// SanitizeErrors wrapped anywhere in err's chain (Decode wraps it with
+// fmt.Errorf("failed to sanitize ...: %w", err)) is unwrapped into
+// Diagnostics.Errors; anything else (a parse failure, a hook failure) is
+// returned unchanged so it isn't mistaken for a sanitize diagnostic.
+func newDiagnostics(err error, warnings []*SanitizeWarning) error {
+	if err == nil && len(warnings) == 0 {
+		return nil
+	}
+	if err == nil {
+		return &Diagnostics{Warnings: warnings}
+	}
+
+	var single *SanitizeError
+	if errors.As(err, &single) {
+		return &Diagnostics{Errors: SanitizeErrors{single}, Warnings: warnings}
+	}
+
+	var multi SanitizeErrors
+	if errors.As(err, &multi) {
+		return &Diagnostics{Errors: multi, Warnings: warnings}
+	}
+
+	return err
+}
+
+// DecodeHook is a named, ordered transformation that DecodeWithHooks runs
+// over a decoded document, either before or after sanitize normalizes map
+// shapes. Subsystems register hooks to inject cross-cutting behavior --
+// ((var)) interpolation, credential redaction, $ENV expansion -- without
+// forking Concourse's decode path.
+type DecodeHook struct {
+	Name  string
+	Phase HookPhase
+
+	// Run is called once per node in the document (maps, slices, and
+	// scalars alike). It returns the (possibly rewritten) value, any
+	// warnings to surface to the user, and an error if the document should
+	// be rejected outright. In the HookAfterSanitize phase a subtree held
+	// in a *LazyValue (see lazyFieldKeys) reaches Run as that one
+	// *LazyValue; the nodes inside it are not visited.
+	Run func(path Path, value interface{}) (interface{}, []*SanitizeWarning, error)
+}
+
+// HookRegistry holds an ordered set of DecodeHooks. Hooks within a phase run
+// in registration order.
+type HookRegistry struct {
+	mu    sync.Mutex
+	hooks []DecodeHook
+}
+
+// NewHookRegistry returns an empty HookRegistry.
+func NewHookRegistry() *HookRegistry {
+	return &HookRegistry{}
+}
+
+// Register adds h to the registry. It's safe to call concurrently. Each
+// phase of a decode reads the registry when that phase begins, so a hook
+// registered during a decode applies to it only if its phase hasn't started.
+func (r *HookRegistry) Register(h DecodeHook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, h)
+}
+
+func (r *HookRegistry) hooksForPhase(phase HookPhase) []DecodeHook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out []DecodeHook
+	for _, h := range r.hooks {
+		if h.Phase == phase {
+			out = append(out, h)
+		}
+	}
+
+	return out
+}
+
+// apply runs every hook registered for phase over root, depth-first, and
+// appends any warnings they emit to warnings.
+func (r *HookRegistry) apply(phase HookPhase, root interface{}, warnings *[]*SanitizeWarning) (interface{}, error) {
+	hooks := r.hooksForPhase(phase)
+	if len(hooks) == 0 {
+		return root, nil
+	}
+
+	return hookWalk(root, nil, hooks, warnings)
+}
+
+// hookWalk runs hooks against value, then recurses into it, so a hook that
+// rewrites a map's shape still has its children visited afterward.
+func hookWalk(value interface{}, path Path, hooks []DecodeHook, warnings *[]*SanitizeWarning) (interface{}, error) {
+	for _, h := range hooks {
+		transformed, warns, err := h.Run(path, value)
+		if err != nil {
+			return nil, fmt.Errorf("hook %q failed at %s: %w", h.Name, path, err)
+		}
+
+		*warnings = append(*warnings, warns...)
+		value = transformed
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, sub := range v {
+			next, err := hookWalk(sub, path.push(key), hooks, warnings)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = next
+		}
+		return v, nil
+
+	case map[interface{}]interface{}:
+		for key, sub := range v {
+			next, err := hookWalk(sub, path.push(key), hooks, warnings)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = next
+		}
+		return v, nil
+
+	case []interface{}:
+		for i, sub := range v {
+			next, err := hookWalk(sub, path.push(i), hooks, warnings)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = next
+		}
+		return v, nil
+
+	default:
+		return value, nil
+	}
+}
+
+// DefaultHooks is the registry atc's own pipeline, task, and resource type
+// decode paths consult unless a caller supplies its own via
+// Decoder.DecodeWithRegistry. Operators register org-specific hooks here --
+// enforcing image digests, rewriting registry hostnames, and the like -- as
+// a plugin point rather than forking Concourse.
+var DefaultHooks = NewHookRegistry()
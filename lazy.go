@@ -0,0 +1,249 @@
+package atc
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+var lazyValuePtrType = reflect.TypeOf(&LazyValue{})
+
+// lazyFieldKeys walks t's type graph -- following pointers, slices, and
+// struct fields -- and collects the mapstructure tag name of every field
+// typed *LazyValue. Decoder.DecodeWithRegistry passes the result to
+// sanitizeWithSkip as the set of map keys to leave alone, so a pipeline's
+// params/config blocks are handed to LazyValueHookFunc unsanitized instead
+// of being walked (and fully allocated) before anything asks for them.
+func lazyFieldKeys(t reflect.Type) map[string]bool {
+	keys := map[string]bool{}
+	collectLazyFieldKeys(t, keys, map[reflect.Type]bool{})
+	return keys
+}
+
+func collectLazyFieldKeys(t reflect.Type, keys map[string]bool, seen map[reflect.Type]bool) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct || seen[t] {
+		return
+	}
+	seen[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.Type == lazyValuePtrType {
+			if name := mapstructureFieldName(field); name != "" {
+				keys[name] = true
+			}
+			continue
+		}
+
+		collectLazyFieldKeys(field.Type, keys, seen)
+	}
+}
+
+// mapstructureFieldName returns the key mapstructure would decode into
+// field, honoring its mapstructure tag the same way mapstructure itself
+// does (falling back to the field name, and skipping fields tagged "-").
+func mapstructureFieldName(field reflect.StructField) string {
+	tag, ok := field.Tag.Lookup("mapstructure")
+	if !ok {
+		return field.Name
+	}
+
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+
+	return name
+}
+
+// LazyValueHookFunc is a mapstructure decode hook that lets a pipeline/job/
+// step struct declare an opaque field -- a job's params or a task step's
+// config -- as *LazyValue instead of map[string]interface{}, so fields the
+// caller never reads are never sanitized eagerly. decodeInto registers this
+// by default.
+func LazyValueHookFunc() mapstructure.DecodeHookFunc {
+	return func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+		if to != lazyValuePtrType {
+			return data, nil
+		}
+
+		// sanitizeWithSkip (or sanitizeStrictWithSkip) already wrapped this
+		// field's value into a
+		// *LazyValue itself (it knows which keys are bound to a *LazyValue
+		// field via lazyFieldKeys); only fall back to wrapping it here for a
+		// caller that reached this hook some other way, e.g. driving
+		// mapstructure directly against a tree sanitize already walked.
+		if lv, ok := data.(*LazyValue); ok {
+			return lv, nil
+		}
+
+		return SanitizeLazy(data)
+	}
+}
+
+// LazyValue wraps a YAML/JSON-decoded subtree (still shaped the way the
+// frontend produced it, e.g. map[interface{}]interface{} for YAML) and
+// defers rebuilding it into the map[string]interface{} / []interface{} shape
+// sanitize produces until something actually asks for it. Large documents --
+// multi-thousand-job pipelines are the motivating case -- often have whole
+// subtrees (a job's params block, say) that a caller is never going to look
+// at, so there's no reason to allocate a sanitized copy of them up front.
+//
+// LazyValue embeds a sync.Once and must not be copied after construction;
+// always handle it through *LazyValue.
+type LazyValue struct {
+	raw          interface{}
+	once         sync.Once
+	materialized interface{}
+	err          error
+}
+
+// SanitizeLazy validates that every map key in root is a string, matching
+// sanitize's error semantics, but defers rebuilding the map/slice tree
+// itself until a caller calls Value, Map, or Slice on some subtree.
+func SanitizeLazy(root interface{}) (*LazyValue, error) {
+	if err := validateStringKeys(root, nil); err != nil {
+		return nil, err
+	}
+
+	return &LazyValue{raw: root}, nil
+}
+
+// validateStringKeys walks root without building a sanitized copy, checking that
+// every map it finds uses string keys. This is the one pass SanitizeLazy
+// can't defer: without it, a bad key deep in an untouched subtree would
+// surface as a confusing panic or silent data loss whenever that subtree
+// finally got materialized, rather than as an error from SanitizeLazy
+// itself.
+//
+// root is usually still frontend-shaped: map[interface{}]interface{} for
+// YAML, or map[string]interface{} for the JSON, TOML and HCL frontends.
+// LazyValueHookFunc can also be handed a tree sanitize already walked, which
+// is map[string]interface{} as well. That case is just a recursive check
+// with no key type left to validate.
+func validateStringKeys(root interface{}, path Path) error {
+	switch v := root.(type) {
+	case map[interface{}]interface{}:
+		for key, val := range v {
+			str, ok := key.(string)
+			if !ok {
+				return &SanitizeError{Path: path, Value: key, Code: SanitizeErrorNonStringKey}
+			}
+
+			if err := validateStringKeys(val, path.push(str)); err != nil {
+				return err
+			}
+		}
+
+	case map[string]interface{}:
+		for str, val := range v {
+			if err := validateStringKeys(val, path.push(str)); err != nil {
+				return err
+			}
+		}
+
+	case []interface{}:
+		for i, val := range v {
+			if err := validateStringKeys(val, path.push(i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Value returns this node's sanitized view: a map[string]*LazyValue for a
+// map, a []*LazyValue for a sequence, or the scalar itself. Nested
+// maps/slices are wrapped rather than recursively sanitized, so the cost of
+// materializing a node never depends on the size of its children. The
+// result (and any error) is cached, so repeated calls are free after the
+// first.
+//
+// An error here only happens for a LazyValue built by hand rather than via
+// SanitizeLazy/materializeShallow, since SanitizeLazy already validated
+// every key in the tree up front.
+func (v *LazyValue) Value() (interface{}, error) {
+	v.once.Do(func() {
+		v.materialized, v.err = materializeShallow(v.raw)
+	})
+
+	return v.materialized, v.err
+}
+
+func materializeShallow(raw interface{}) (interface{}, error) {
+	switch rv := raw.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]*LazyValue, len(rv))
+		for key, val := range rv {
+			str, ok := key.(string)
+			if !ok {
+				return nil, &SanitizeError{Value: key, Code: SanitizeErrorNonStringKey}
+			}
+			out[str] = &LazyValue{raw: val}
+		}
+		return out, nil
+
+	// Reached for string-keyed input (see validateStringKeys above for when
+	// that happens); there's no key type left to check.
+	case map[string]interface{}:
+		out := make(map[string]*LazyValue, len(rv))
+		for str, val := range rv {
+			out[str] = &LazyValue{raw: val}
+		}
+		return out, nil
+
+	case []interface{}:
+		out := make([]*LazyValue, len(rv))
+		for i, val := range rv {
+			out[i] = &LazyValue{raw: val}
+		}
+		return out, nil
+
+	default:
+		return rv, nil
+	}
+}
+
+// Map returns v's materialized value as a map[string]*LazyValue, or
+// ok=false if this node isn't a map (or failed to materialize).
+func (v *LazyValue) Map() (m map[string]*LazyValue, ok bool) {
+	val, err := v.Value()
+	if err != nil {
+		return nil, false
+	}
+
+	m, ok = val.(map[string]*LazyValue)
+	return
+}
+
+// Slice returns v's materialized value as a []*LazyValue, or ok=false if
+// this node isn't a sequence (or failed to materialize).
+func (v *LazyValue) Slice() (s []*LazyValue, ok bool) {
+	val, err := v.Value()
+	if err != nil {
+		return nil, false
+	}
+
+	s, ok = val.([]*LazyValue)
+	return
+}
+
+// Sanitize eagerly rebuilds this subtree and everything beneath it into the
+// same map[string]interface{} / []interface{} shape sanitize returns. Call
+// it when a consumer genuinely needs the whole value at once -- e.g.
+// marshaling a params block back out over the API -- rather than navigating
+// it field by field via Map/Slice.
+func (v *LazyValue) Sanitize() (interface{}, error) {
+	return sanitize(v.raw)
+}
@@ -0,0 +1,288 @@
+package atc
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeLazyRejectsNonStringKeys(t *testing.T) {
+	_, err := SanitizeLazy(map[interface{}]interface{}{1: "oops"})
+	if err == nil {
+		t.Fatal("expected an error for a non-string key")
+	}
+
+	se, ok := err.(*SanitizeError)
+	if !ok {
+		t.Fatalf("expected *SanitizeError, got %T", err)
+	}
+	if se.Code != SanitizeErrorNonStringKey {
+		t.Errorf("expected code %q, got %q", SanitizeErrorNonStringKey, se.Code)
+	}
+}
+
+func TestLazyValueMap(t *testing.T) {
+	lv, err := SanitizeLazy(map[interface{}]interface{}{
+		"name":   "build",
+		"params": map[interface{}]interface{}{"TAG": "1.20"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, ok := lv.Map()
+	if !ok {
+		t.Fatal("expected the root to materialize as a map")
+	}
+
+	name, err := m["name"].Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "build" {
+		t.Errorf("expected name %q, got %q", "build", name)
+	}
+
+	params, ok := m["params"].Map()
+	if !ok {
+		t.Fatal("expected params to materialize as a map")
+	}
+	tag, err := params["TAG"].Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag != "1.20" {
+		t.Errorf("expected TAG %q, got %q", "1.20", tag)
+	}
+}
+
+func TestLazyValueSlice(t *testing.T) {
+	lv, err := SanitizeLazy([]interface{}{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, ok := lv.Slice()
+	if !ok {
+		t.Fatal("expected the root to materialize as a slice")
+	}
+	if len(items) != 3 {
+		t.Fatalf("expected 3 items, got %d", len(items))
+	}
+
+	second, err := items[1].Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != "b" {
+		t.Errorf("expected %q, got %q", "b", second)
+	}
+}
+
+func TestLazyValueSanitizeMatchesEagerSanitize(t *testing.T) {
+	raw := map[interface{}]interface{}{
+		"jobs": []interface{}{
+			map[interface{}]interface{}{"name": "build"},
+		},
+	}
+
+	want, err := sanitize(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lv, err := SanitizeLazy(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := lv.Sanitize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("lv.Sanitize() = %#v, want %#v", got, want)
+	}
+}
+
+func TestDecodeIntoLazyValueField(t *testing.T) {
+	src := `
+task: unit
+params:
+  TAG: "1.20"
+  REGISTRY: docker.example.com
+`
+
+	var step PlanConfig
+	if err := NewDecoder().Decode([]byte(src), FormatYAML, &step); err != nil {
+		t.Fatal(err)
+	}
+
+	if step.Params == nil {
+		t.Fatal("expected Params to be set")
+	}
+
+	params, ok := step.Params.Map()
+	if !ok {
+		t.Fatal("expected Params to materialize as a map")
+	}
+
+	tag, err := params["TAG"].Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag != "1.20" {
+		t.Errorf("expected TAG %q, got %q", "1.20", tag)
+	}
+}
+
+// TestDecodeDefersLazyValueFields is a white-box check that
+// Decoder.DecodeWithRegistry actually leaves a *LazyValue field's subtree
+// unmaterialized rather than sanitizing it up front and only then handing
+// it to LazyValueHookFunc -- which would pass TestDecodeIntoLazyValueField
+// just as well, but pay for the allocation a *LazyValue field is meant to
+// avoid. It does so by checking that Params still holds the raw YAML map.
+func TestDecodeDefersLazyValueFields(t *testing.T) {
+	src := `
+task: unit
+params:
+  TAG: "1.20"
+`
+
+	var step PlanConfig
+	if err := NewDecoder().Decode([]byte(src), FormatYAML, &step); err != nil {
+		t.Fatal(err)
+	}
+
+	if step.Params == nil {
+		t.Fatal("expected Params to be set")
+	}
+	if step.Params.materialized != nil {
+		t.Fatal("expected Params to still be unmaterialized immediately after Decode")
+	}
+	if _, ok := step.Params.raw.(map[interface{}]interface{}); !ok {
+		t.Fatalf("expected Params to still hold the raw YAML map, got %T", step.Params.raw)
+	}
+}
+
+// buildSyntheticPipeline builds a map[interface{}]interface{} tree with
+// roughly n nodes, shaped like a pipeline with many jobs each carrying a
+// params block the benchmark never reads -- the case sanitize pays full
+// price for and SanitizeLazy is meant to avoid.
+func buildSyntheticPipeline(n int) map[interface{}]interface{} {
+	jobsNeeded := n / 6 // ~6 nodes per job: map, name, params map, and 3 params
+	if jobsNeeded < 1 {
+		jobsNeeded = 1
+	}
+
+	jobs := make([]interface{}, jobsNeeded)
+	for i := 0; i < jobsNeeded; i++ {
+		jobs[i] = map[interface{}]interface{}{
+			"name": fmt.Sprintf("job-%d", i),
+			"params": map[interface{}]interface{}{
+				"TAG":      "1.20",
+				"REGISTRY": "docker.example.com",
+				"DIGEST":   "sha256:deadbeef",
+			},
+		}
+	}
+
+	return map[interface{}]interface{}{"jobs": jobs}
+}
+
+func benchmarkSanitize(b *testing.B, n int) {
+	pipeline := buildSyntheticPipeline(n)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := sanitize(pipeline); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkSanitizeLazyListOnly(b *testing.B, n int) {
+	pipeline := buildSyntheticPipeline(n)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lv, err := SanitizeLazy(pipeline)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		root, ok := lv.Map()
+		if !ok {
+			b.Fatal("expected root to be a map")
+		}
+
+		jobs, ok := root["jobs"].Slice()
+		if !ok {
+			b.Fatal("expected jobs to be a slice")
+		}
+
+		for _, job := range jobs {
+			m, ok := job.Map()
+			if !ok {
+				b.Fatal("expected job to be a map")
+			}
+			if _, err := m["name"].Value(); err != nil {
+				b.Fatal(err)
+			}
+			// params is deliberately never touched here.
+		}
+	}
+}
+
+func BenchmarkSanitize100K(b *testing.B) { benchmarkSanitize(b, 100_000) }
+func BenchmarkSanitize1M(b *testing.B)   { benchmarkSanitize(b, 1_000_000) }
+func BenchmarkSanitize10M(b *testing.B)  { benchmarkSanitize(b, 10_000_000) }
+
+func BenchmarkSanitizeLazyListOnly100K(b *testing.B) { benchmarkSanitizeLazyListOnly(b, 100_000) }
+func BenchmarkSanitizeLazyListOnly1M(b *testing.B)   { benchmarkSanitizeLazyListOnly(b, 1_000_000) }
+func BenchmarkSanitizeLazyListOnly10M(b *testing.B)  { benchmarkSanitizeLazyListOnly(b, 10_000_000) }
+
+// buildSyntheticPipelineYAML renders roughly the same shape
+// buildSyntheticPipeline builds, but as YAML source, so
+// BenchmarkDecodeConfigParamsUnread can exercise the real Decoder.Decode
+// path rather than calling SanitizeLazy directly.
+func buildSyntheticPipelineYAML(jobs int) []byte {
+	var sb strings.Builder
+	sb.WriteString("jobs:\n")
+	for i := 0; i < jobs; i++ {
+		fmt.Fprintf(&sb, "  - name: job-%d\n", i)
+		sb.WriteString("    plan:\n")
+		sb.WriteString("      - task: build\n")
+		sb.WriteString("        params:\n")
+		sb.WriteString("          TAG: \"1.20\"\n")
+		sb.WriteString("          REGISTRY: docker.example.com\n")
+		sb.WriteString("          DIGEST: sha256:deadbeef\n")
+	}
+	return []byte(sb.String())
+}
+
+// benchmarkDecodeConfigParamsUnread decodes a synthetic pipeline through
+// Decoder.Decode and reads only each job's name, never its plan steps'
+// params -- the scenario Decoder.DecodeWithRegistry's use of
+// lazyFieldKeys/sanitizeWithSkip is meant to make cheap.
+func benchmarkDecodeConfigParamsUnread(b *testing.B, jobs int) {
+	data := buildSyntheticPipelineYAML(jobs)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var cfg Config
+		if err := NewDecoder().Decode(data, FormatYAML, &cfg); err != nil {
+			b.Fatal(err)
+		}
+		for _, job := range cfg.Jobs {
+			_ = job.Name
+		}
+	}
+}
+
+func BenchmarkDecodeConfigParamsUnread1K(b *testing.B)  { benchmarkDecodeConfigParamsUnread(b, 1_000) }
+func BenchmarkDecodeConfigParamsUnread10K(b *testing.B) { benchmarkDecodeConfigParamsUnread(b, 10_000) }
@@ -0,0 +1,135 @@
+package atc
+
+import (
+	"strconv"
+
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// LineMap maps a Path (rendered as a string, e.g. "/jobs/2/name") to the
+// 1-indexed line it appeared on in the original YAML source. It lets
+// SanitizeError diagnostics point the user at the exact line rather than
+// just the structural path.
+type LineMap map[string]int
+
+// BuildLineMap parses a YAML document a second time, preserving node
+// position information, and returns a LineMap covering every key and list
+// index in it. It's only meaningful for FormatYAML input; other frontends
+// don't carry line information through to sanitize.
+func BuildLineMap(data []byte) (LineMap, error) {
+	lines, _, err := analyzeYAML(data)
+	return lines, err
+}
+
+// detectDuplicateKeysYAML re-parses data with its node positions intact and
+// reports every map key that appears more than once, with its Line already
+// set. It has to run against the original bytes: by the time sanitize sees
+// a document, yaml.Unmarshal has already collapsed duplicate keys into
+// whichever one it saw last.
+func detectDuplicateKeysYAML(data []byte) (SanitizeErrors, error) {
+	_, errs, err := analyzeYAML(data)
+	return errs, err
+}
+
+// analyzeYAML parses data once with yaml.v3, which -- unlike yaml.v2's
+// generic interface{} decode -- preserves node position and lets us see
+// every key a mapping node holds, including ones that a plain Unmarshal
+// would have silently overwritten. It returns both the LineMap and any
+// duplicate-key violations found along the way, so callers that want both
+// don't pay for parsing twice.
+func analyzeYAML(data []byte) (LineMap, SanitizeErrors, error) {
+	var doc yaml3.Node
+	if err := yaml3.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+
+	lines := LineMap{}
+	var errs SanitizeErrors
+	if len(doc.Content) > 0 {
+		walkYAML(doc.Content[0], nil, lines, &errs)
+	}
+
+	return lines, errs, nil
+}
+
+func walkYAML(node *yaml3.Node, path Path, lines LineMap, errs *SanitizeErrors) {
+	lines[path.String()] = node.Line
+
+	switch node.Kind {
+	case yaml3.MappingNode:
+		seen := map[string]bool{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode, valNode := node.Content[i], node.Content[i+1]
+			keyPath := path.push(keyNode.Value)
+
+			if seen[keyNode.Value] {
+				*errs = append(*errs, &SanitizeError{
+					Path:  keyPath,
+					Value: keyNode.Value,
+					Code:  SanitizeErrorDuplicateKey,
+					Line:  keyNode.Line,
+				})
+			}
+			seen[keyNode.Value] = true
+
+			walkYAML(valNode, keyPath, lines, errs)
+		}
+
+	case yaml3.SequenceNode:
+		for i, item := range node.Content {
+			walkYAML(item, path.push(i), lines, errs)
+		}
+	}
+}
+
+// Lookup returns the line for the given SanitizeError, or 0 if the path
+// wasn't seen while building the map (e.g. it came from a non-YAML source).
+func (m LineMap) Lookup(err *SanitizeError) int {
+	return m[err.Path.String()]
+}
+
+// AnnotateLines fills in the Line field of every SanitizeError in err (a
+// *SanitizeError or a SanitizeErrors) using data's line map, so fly/the API
+// can point a diagnostic at the exact line rather than just the structural
+// Path. It mutates the error(s) in place and returns err unchanged, so it
+// composes with %w wrapping. Errors that already carry a Line (duplicate
+// keys, detected directly against node positions) are left alone; anything
+// that isn't a *SanitizeError/SanitizeErrors, or a line map build failure,
+// is a silent no-op -- annotation is a diagnostic nicety, not something
+// that should turn a real decode error into a different one.
+func AnnotateLines(data []byte, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	lines, lerr := BuildLineMap(data)
+	if lerr != nil {
+		return err
+	}
+
+	switch e := err.(type) {
+	case *SanitizeError:
+		if e.Line == 0 {
+			e.Line = lines.Lookup(e)
+		}
+	case SanitizeErrors:
+		for _, se := range e {
+			if se.Line == 0 {
+				se.Line = lines.Lookup(se)
+			}
+		}
+	}
+
+	return err
+}
+
+// String renders a "line N" suffix suitable for appending to a diagnostic
+// message, or "" if no line is known.
+func (m LineMap) String(err *SanitizeError) string {
+	line := m.Lookup(err)
+	if line == 0 {
+		return ""
+	}
+
+	return "line " + strconv.Itoa(line)
+}
@@ -0,0 +1,23 @@
+package atc
+
+// Config is the root of a decoded pipeline configuration.
+type Config struct {
+	Jobs []JobConfig `mapstructure:"jobs"`
+}
+
+// JobConfig is a single job within a pipeline. Plan holds the job's build
+// plan, one PlanConfig (a "step") per entry.
+type JobConfig struct {
+	Name string       `mapstructure:"name"`
+	Plan []PlanConfig `mapstructure:"plan"`
+}
+
+// PlanConfig is one step of a job's build plan (a get, put, task, etc). Its
+// Params and Config fields are the kind of opaque, often-unread blobs
+// SanitizeLazy was built for: a caller listing jobs across a large pipeline
+// has no reason to pay for sanitizing every step's params up front.
+type PlanConfig struct {
+	Task   string     `mapstructure:"task"`
+	Params *LazyValue `mapstructure:"params"`
+	Config *LazyValue `mapstructure:"config"`
+}
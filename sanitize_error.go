@@ -0,0 +1,244 @@
+package atc
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SanitizeErrorCode identifies the class of violation a SanitizeError
+// describes, so callers can distinguish "reject this outright" conditions
+// from ones they might choose to warn on instead.
+type SanitizeErrorCode string
+
+const (
+	SanitizeErrorNonStringKey SanitizeErrorCode = "non-string-key"
+	SanitizeErrorDuplicateKey SanitizeErrorCode = "duplicate-key"
+	SanitizeErrorNonFiniteNum SanitizeErrorCode = "non-finite-number"
+	SanitizeErrorInvalidUTF8  SanitizeErrorCode = "invalid-utf8"
+)
+
+// Path identifies the location of a value within a decoded pipeline/task
+// document, using the same segments a JSON Pointer (RFC 6901) would: map
+// keys and slice indices, outermost first.
+type Path []interface{}
+
+// String renders the path as a JSON-Pointer-style string, e.g.
+// "/jobs/2/plan/0/config/params/42".
+func (p Path) String() string {
+	if len(p) == 0 {
+		return "/"
+	}
+
+	var sb strings.Builder
+	for _, seg := range p {
+		sb.WriteByte('/')
+		switch v := seg.(type) {
+		case int:
+			sb.WriteString(strconv.Itoa(v))
+		case string:
+			sb.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(v))
+		default:
+			fmt.Fprintf(&sb, "%v", v)
+		}
+	}
+
+	return sb.String()
+}
+
+// push returns a copy of p with seg appended, so callers can extend a path
+// while recursing without aliasing the caller's slice.
+func (p Path) push(seg interface{}) Path {
+	next := make(Path, len(p)+1)
+	copy(next, p)
+	next[len(p)] = seg
+	return next
+}
+
+// SanitizeError is returned by sanitize and SanitizeStrict to report
+// precisely where in a pipeline document a violation occurred.
+type SanitizeError struct {
+	Path  Path
+	Value interface{}
+	Code  SanitizeErrorCode
+
+	// Line is the 1-indexed line the offending value appeared on in the
+	// original source, or 0 if unknown (e.g. the source wasn't YAML, or no
+	// LineMap was available). Decoder.DecodeWithRegistry fills this in for
+	// YAML input.
+	Line int
+}
+
+func (e *SanitizeError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s: %v (at %s, line %d)", e.Code, e.Value, e.Path, e.Line)
+	}
+
+	return fmt.Sprintf("%s: %v (at %s)", e.Code, e.Value, e.Path)
+}
+
+// SanitizeErrors collects every violation found during a strict-mode
+// sanitize pass, rather than aborting at the first one.
+type SanitizeErrors []*SanitizeError
+
+func (errs SanitizeErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// SanitizeStrict behaves like sanitize, but additionally rejects NaN/Inf
+// floats and non-UTF8 strings, returning every violation it finds rather
+// than just the first. root has already been through a frontend's
+// Unmarshal by the time it gets here, which silently collapses duplicate
+// keys into the last-seen value -- so duplicate-key detection can't happen
+// in this pass; see detectDuplicateKeysYAML/detectDuplicateKeysJSON, which
+// Decoder.DecodeWithRegistry runs against the original bytes, where every
+// key is still present.
+func SanitizeStrict(root interface{}) (interface{}, error) {
+	return sanitizeStrictWithSkip(root, nil)
+}
+
+// sanitizeStrictWithSkip is SanitizeStrict plus skip, the set of map keys
+// Decoder.DecodeWithRegistry wants left for LazyValueHookFunc rather than
+// sanitized eagerly; see sanitizeWithSkip for why.
+func sanitizeStrictWithSkip(root interface{}, skip map[string]bool) (interface{}, error) {
+	var errs SanitizeErrors
+
+	sanitized := sanitizeWalk(root, nil, true, &errs, skip)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return sanitized, nil
+}
+
+// sanitizeWalk is the shared implementation behind sanitize and
+// SanitizeStrict. In non-strict mode it stops as soon as errs has one entry,
+// matching sanitize's historical first-error-wins behavior; in strict mode
+// it keeps walking so callers see every problem in one pass.
+//
+// skip holds the map keys that should be wrapped into a *LazyValue via
+// SanitizeLazy instead of recursed into -- built by lazyFieldKeys from the
+// decode target's *LazyValue-typed fields -- so a subtree a caller never
+// reads is never walked at all. In strict mode such a subtree is still walked
+// once for its checks, but the *LazyValue wraps its raw value. It's nil
+// outside the decode path, where sanitize/SanitizeStrict always walk
+// everything as before.
+func sanitizeWalk(root interface{}, path Path, strict bool, errs *SanitizeErrors, skip map[string]bool) interface{} {
+	if !strict && len(*errs) > 0 {
+		return nil
+	}
+
+	switch rootVal := root.(type) {
+	case map[interface{}]interface{}:
+		sanitized := map[string]interface{}{}
+
+		for key, val := range rootVal {
+			str, ok := key.(string)
+			if !ok {
+				*errs = append(*errs, &SanitizeError{
+					Path:  path,
+					Value: key,
+					Code:  SanitizeErrorNonStringKey,
+				})
+				if !strict {
+					return nil
+				}
+				continue
+			}
+
+			if skip[str] {
+				if strict {
+					// Strict checks cover the whole document, so the subtree
+					// is walked for its errors only and its copy discarded.
+					before := len(*errs)
+					sanitizeWalk(val, path.push(str), true, errs, nil)
+					if len(*errs) == before {
+						sanitized[str] = &LazyValue{raw: val}
+					}
+					continue
+				}
+
+				lv, lerr := SanitizeLazy(val)
+				if lerr != nil {
+					if se, ok := lerr.(*SanitizeError); ok {
+						se.Path = append(path.push(str), se.Path...)
+						*errs = append(*errs, se)
+					}
+					if !strict {
+						return nil
+					}
+					continue
+				}
+
+				sanitized[str] = lv
+				continue
+			}
+
+			sub := sanitizeWalk(val, path.push(str), strict, errs, skip)
+			if !strict && len(*errs) > 0 {
+				return nil
+			}
+
+			sanitized[str] = sub
+		}
+
+		return sanitized
+
+	case map[string]interface{}:
+		// The JSON, TOML and HCL frontends already produce string keys; walk
+		// them the same way so strict checks and skip apply to them too.
+		generic := make(map[interface{}]interface{}, len(rootVal))
+		for key, val := range rootVal {
+			generic[key] = val
+		}
+		return sanitizeWalk(generic, path, strict, errs, skip)
+
+	case []map[string]interface{}:
+		// TOML's arrays of tables.
+		generic := make([]interface{}, len(rootVal))
+		for i, val := range rootVal {
+			generic[i] = val
+		}
+		return sanitizeWalk(generic, path, strict, errs, skip)
+
+	case []interface{}:
+		sanitized := make([]interface{}, len(rootVal))
+		for i, val := range rootVal {
+			sanitized[i] = sanitizeWalk(val, path.push(i), strict, errs, skip)
+			if !strict && len(*errs) > 0 {
+				return nil
+			}
+		}
+		return sanitized
+
+	case string:
+		if strict && !utf8.ValidString(rootVal) {
+			*errs = append(*errs, &SanitizeError{
+				Path:  path,
+				Value: rootVal,
+				Code:  SanitizeErrorInvalidUTF8,
+			})
+		}
+		return rootVal
+
+	case float64:
+		if strict && (math.IsNaN(rootVal) || math.IsInf(rootVal, 0)) {
+			*errs = append(*errs, &SanitizeError{
+				Path:  path,
+				Value: rootVal,
+				Code:  SanitizeErrorNonFiniteNum,
+			})
+		}
+		return rootVal
+
+	default:
+		return rootVal
+	}
+}